@@ -8,8 +8,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"regexp"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	// "log"
@@ -71,36 +71,62 @@ func init() {
 
 const userAgentDefault = "Mozilla/5.0 (X11; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0"
 
+const concurrencyDefault = 8
+
 type HTTPClient struct {
 	userAgent    string
 	smsessCookie string
+	oauth        *OAuth1Signer
+	client       *http.Client
 }
 
-func NewHTTPClient(userAgent, smsessCookie string) *HTTPClient {
-	return &HTTPClient{userAgent: userAgent, smsessCookie: smsessCookie}
+func NewHTTPClient(userAgent, smsessCookie string, oauth *OAuth1Signer, concurrency int) *HTTPClient {
+	transport := &http.Transport{
+		MaxIdleConns:        concurrency * 2,
+		MaxIdleConnsPerHost: concurrency * 2,
+		MaxConnsPerHost:     concurrency * 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &HTTPClient{
+		userAgent:    userAgent,
+		smsessCookie: smsessCookie,
+		oauth:        oauth,
+		client:       &http.Client{Transport: transport},
+	}
 }
 
 const retries = 3
 
-func (c *HTTPClient) Req(url string) ([]byte, error) {
+// newReq builds a GET request authenticated either via OAuth 1.0a (if
+// configured) or the legacy SMSESS browser-session cookie.
+func (c *HTTPClient) newReq(url string) (*http.Request, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-
 	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Cookie", fmt.Sprintf("SMSESS=%v", c.smsessCookie))
+	if c.oauth != nil {
+		if err := c.oauth.Sign(req); err != nil {
+			return nil, fmt.Errorf("can't sign request: %w", err)
+		}
+	} else {
+		req.Header.Set("Cookie", fmt.Sprintf("SMSESS=%v", c.smsessCookie))
+	}
+	return req, nil
+}
 
+// doReq performs req, retrying on 5xx responses, and returns the response
+// with a body the caller is responsible for closing.
+func (c *HTTPClient) doReq(req *http.Request) (*http.Response, error) {
 	attempt := 0
 	for {
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := c.client.Do(req)
 		if err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
 
 		if resp.StatusCode != 200 {
+			resp.Body.Close()
 			if 500 <= resp.StatusCode && resp.StatusCode < 600 {
 				if attempt == retries {
 					return nil, fmt.Errorf("reached max req attempts; resp.StatusCode is %v", resp.StatusCode)
@@ -109,13 +135,40 @@ func (c *HTTPClient) Req(url string) ([]byte, error) {
 				log.Warnf("res.StatusCode is %v, trying again (attempt %v)", resp.StatusCode, attempt)
 				time.Sleep(500 * time.Millisecond)
 				continue
-			} else {
-				return nil, fmt.Errorf("resp.StatusCode is %v", resp.StatusCode)
 			}
+			return nil, fmt.Errorf("resp.StatusCode is %v", resp.StatusCode)
 		}
-		return ioutil.ReadAll(resp.Body)
+		return resp, nil
+	}
+}
+
+func (c *HTTPClient) Req(url string) ([]byte, error) {
+	req, err := c.newReq(url)
+	if err != nil {
+		return nil, err
 	}
+	resp, err := c.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
 
+// ReqStream performs a GET request and returns the response body as a
+// stream, for callers that want to copy it directly to a destination
+// (e.g. a file) without buffering it in memory. The caller must close the
+// returned io.ReadCloser.
+func (c *HTTPClient) ReqStream(url string) (io.ReadCloser, error) {
+	req, err := c.newReq(url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
 }
 
 func (c *HTTPClient) ReqJSON(url string, v interface{}) error {
@@ -160,10 +213,14 @@ type Image struct {
 	ImageKey         string
 	ArchivedUri      string
 	ArchivedMD5      string
+	IsVideo          bool
 	Uris             struct {
 		LargestImage struct {
 			Uri string
 		}
+		LargestVideo struct {
+			Uri string
+		}
 	}
 }
 
@@ -172,6 +229,10 @@ type ImageSize struct {
 		Url string
 		MD5 string
 	}
+	LargestVideo struct {
+		Url string
+		MD5 string
+	}
 }
 
 type FolderResponse struct {
@@ -229,7 +290,7 @@ func (b *AlbumURLBuilder) URL(albumID string, start int) (string, error) {
 	params.Add("SortDirection", "Descending")
 	params.Add("count", "50")
 	params.Add("start", fmt.Sprintf("%v", start))
-	params.Add("_expand", "LargestImage")
+	params.Add("_expand", "LargestImage,LargestVideo")
 	albumURL.RawQuery = params.Encode()
 	return albumURL.String(), nil
 }
@@ -240,22 +301,144 @@ func imageHashURL(cli *HTTPClient, album *FolderResponse, image *Image) (string,
 	if image.ArchivedUri != "" {
 		return image.ArchivedMD5, image.ArchivedUri
 	}
+	if image.IsVideo {
+		largestVideo := album.Expansions[image.Uris.LargestVideo.Uri]
+		return largestVideo.LargestVideo.MD5, largestVideo.LargestVideo.Url
+	}
 	largestImage := album.Expansions[image.Uris.LargestImage.Uri]
 	return largestImage.LargestImage.MD5, largestImage.LargestImage.Url
 }
 
-func loopAlbum(cli *HTTPClient, ab *AlbumURLBuilder, path, albumID string) {
+// downloadJob is a single image pending download, emitted by the
+// album/folder walker and consumed by the Downloader worker pool. done is
+// signalled once the job has been attempted, successfully or not, so the
+// walker can wait for an album's jobs before finishing its progress bar.
+type downloadJob struct {
+	url        string
+	hash       string
+	filePath   string
+	bar        *pb.ProgressBar
+	done       *sync.WaitGroup
+	imageKey   string
+	stateEntry StateEntry
+	failures   *int32
+}
+
+// Downloader is a bounded worker pool that streams download jobs to their
+// Storage backend, verifying each against its expected MD5 before it's
+// considered done.
+type Downloader struct {
+	cli            *HTTPClient
+	storage        Storage
+	metadataFormat MetadataFormat
+	manifest       *Manifest
+	state          *State
+	verify         bool
+	since          time.Time
+	wantTypes      map[string]bool
+	jobs           chan downloadJob
+	wg             sync.WaitGroup
+	barMu          sync.Mutex
+}
+
+func NewDownloader(cli *HTTPClient, storage Storage, metadataFormat MetadataFormat, state *State, verify bool, since time.Time, wantTypes map[string]bool, concurrency int) *Downloader {
+	d := &Downloader{
+		cli:            cli,
+		storage:        storage,
+		metadataFormat: metadataFormat,
+		manifest:       &Manifest{},
+		state:          state,
+		verify:         verify,
+		since:          since,
+		wantTypes:      wantTypes,
+		jobs:           make(chan downloadJob, concurrency*2),
+	}
+	for i := 0; i < concurrency; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	return d
+}
+
+func (d *Downloader) worker() {
+	defer d.wg.Done()
+	for job := range d.jobs {
+		err := d.download(job)
+		if err != nil {
+			log.Errorf("can't download %v: %v", job.filePath, err)
+			atomic.AddInt32(job.failures, 1)
+		} else {
+			d.barMu.Lock()
+			job.bar.Increment()
+			d.barMu.Unlock()
+			if d.state != nil {
+				if err := d.state.PutImage(job.imageKey, job.stateEntry); err != nil {
+					log.Errorf("can't update state for %v: %v", job.imageKey, err)
+				}
+			}
+		}
+		job.done.Done()
+	}
+}
+
+// download streams the job's URL to its Storage backend, hashing as it
+// goes, and only commits the write once the streamed MD5 matches the hash
+// SmugMug reported. This keeps a process killed mid-download from ever
+// leaving a truncated file visible at filePath.
+func (d *Downloader) download(job downloadJob) error {
+	body, err := d.cli.ReqStream(job.url)
+	if err != nil {
+		return fmt.Errorf("can't request %v: %w", job.url, err)
+	}
+	defer body.Close()
+
+	w, err := d.storage.Writer(job.filePath)
+	if err != nil {
+		return fmt.Errorf("can't open writer for %v: %w", job.filePath, err)
+	}
+
+	hash := md5.New()
+	_, copyErr := io.Copy(io.MultiWriter(w, hash), body)
+	if copyErr != nil {
+		w.Abort()
+		return fmt.Errorf("can't write %v: %w", job.filePath, copyErr)
+	}
+
+	fileHash := hex.EncodeToString(hash.Sum(nil)[:16])
+	if fileHash != job.hash {
+		w.Abort()
+		return fmt.Errorf("hash mismatch for %v: got %v, expected %v", job.url, fileHash, job.hash)
+	}
+
+	if err := w.Commit(); err != nil {
+		return fmt.Errorf("can't commit %v: %w", job.filePath, err)
+	}
+	return nil
+}
+
+func (d *Downloader) Enqueue(job downloadJob) {
+	d.jobs <- job
+}
+
+// Close waits for all queued jobs to finish and stops the worker pool.
+func (d *Downloader) Close() {
+	close(d.jobs)
+	d.wg.Wait()
+}
+
+// loopAlbum walks one album's pages, downloading images as needed, and
+// returns the number of images that failed to sync (download or stat
+// errors), so callers know not to mark the album's DateModified as synced.
+func loopAlbum(cli *HTTPClient, dl *Downloader, ab *AlbumURLBuilder, path, albumID string, node Node) int {
 	start := 1
 	total := unknownTotal
 	log.Infof("Requesting album at %q with albumID %v", path, albumID)
 
 	var bar *pb.ProgressBar
-	re := regexp.MustCompile(`^([^0-9]*)([0-9]+).jpg$`)
-	type Session struct {
-		Count   int
-		Indexes map[int]bool
-	}
-	sessions := make(map[string]Session)
+	var pending sync.WaitGroup
+	var failures int32
+	var allImages []Image
+	sessions := make(map[string]*session)
 	for start < total {
 		albumURL, err := ab.URL(albumID, start)
 		if err != nil {
@@ -273,71 +456,87 @@ func loopAlbum(cli *HTTPClient, ab *AlbumURLBuilder, path, albumID string) {
 			bar = pb.ProgressBarTemplate(pbTmpl).Start(total)
 		}
 		start += album.Response.Pages.Count
+		allImages = append(allImages, album.Response.AlbumImage...)
 		for _, image := range album.Response.AlbumImage {
-			var sessionName string
-			var index int
-			match := re.FindStringSubmatch(image.FileName)
-			if match == nil {
-				sessionName = strings.TrimSuffix(image.FileName, ".jpg")
-				index = 0
-			} else {
-				sessionName = match[1]
-				index, err = strconv.Atoi(match[2])
-				if err != nil {
-					log.Fatalf("can't convert %q to int: %v", match[2], err)
-				}
-			}
-			if _, ok := sessions[sessionName]; !ok {
-				sessions[sessionName] = Session{
-					Count:   0,
-					Indexes: make(map[int]bool),
-				}
+			if (image.IsVideo && !dl.wantTypes["video"]) || (!image.IsVideo && !dl.wantTypes["image"]) {
+				continue
 			}
-			if _, ok := sessions[sessionName].Indexes[index]; !ok {
-				sessions[sessionName].Indexes[index] = true
-			} else {
-				sessions[sessionName] = Session{
-					Count:   sessions[sessionName].Count + 1,
-					Indexes: make(map[int]bool),
-				}
-				sessions[sessionName].Indexes[index] = true
+
+			ext := filepath.Ext(image.FileName)
+			sessionName, index, err := splitSessionName(image.FileName)
+			if err != nil {
+				log.Fatalf("can't derive session name for %v: %v", image.FileName, err)
 			}
-			prefix := fmt.Sprintf("%02d", sessions[sessionName].Count)
+			prefix := nextPrefix(sessions, sessionName, index, ext)
 			fileName := fmt.Sprintf("%v_%v", prefix, image.FileName)
 			filePath := filepath.Join(path, fileName)
 			imageHash, imageURL := imageHashURL(cli, &album, &image)
-			hash := md5.New()
-			file, err := os.Open(filePath)
-			if err == nil {
-				if _, err := io.Copy(hash, file); err != nil {
-					log.Errorf("can'read open file %v: %v", filePath, err)
+			dl.manifest.Record(filePath, imageHash)
+			stateEntry := StateEntry{
+				DateTimeUploaded: image.DateTimeUploaded,
+				ArchivedMD5:      imageHash,
+				LocalPath:        filePath,
+			}
+
+			if dl.metadataFormat != MetadataNone {
+				if err := writeMetadata(dl.storage, metadataPath(filePath, dl.metadataFormat), dl.metadataFormat, image); err != nil {
+					log.Errorf("can't write metadata for %v: %v", filePath, err)
+				}
+			}
+
+			if dl.state != nil && !dl.verify {
+				entry, found, err := dl.state.GetImage(image.ImageKey)
+				if err != nil {
+					log.Errorf("can't read state for image %v: %v", image.ImageKey, err)
+				} else if found && entry.DateTimeUploaded == image.DateTimeUploaded {
+					bar.Increment()
 					continue
 				}
-				fileHash := hex.EncodeToString(hash.Sum(nil)[:16])
+			}
+
+			fileHash, err := dl.storage.Stat(filePath)
+			if err == nil {
 				if fileHash == imageHash {
 					bar.Increment()
+					if dl.state != nil {
+						if err := dl.state.PutImage(image.ImageKey, stateEntry); err != nil {
+							log.Errorf("can't update state for %v: %v", image.ImageKey, err)
+						}
+					}
 					continue
 				}
 				log.Infof("hash mismatch for existing file %v, downloading again", filePath)
-
-			} else if !os.IsNotExist(err) && err != nil {
-				log.Errorf("can't open file %v: %v", filePath, err)
+			} else if !os.IsNotExist(err) {
+				log.Errorf("can't stat file %v: %v", filePath, err)
+				atomic.AddInt32(&failures, 1)
 				continue
 			}
 
-			imgData, err := cli.Req(imageURL)
-			if err != nil {
-				log.Errorf("can't request %v: %v", image.ArchivedUri, err)
-				continue
-			}
-			if err := ioutil.WriteFile(filePath, imgData, 0644); err != nil {
-				log.Errorf("can't write image file %v: %v", filePath, err)
-				continue
-			}
-			bar.Increment()
+			pending.Add(1)
+			dl.Enqueue(downloadJob{
+				url:        imageURL,
+				hash:       imageHash,
+				filePath:   filePath,
+				bar:        bar,
+				done:       &pending,
+				imageKey:   image.ImageKey,
+				stateEntry: stateEntry,
+				failures:   &failures,
+			})
 		}
 	}
+	pending.Wait()
 	bar.Finish()
+
+	if dl.metadataFormat != MetadataNone {
+		albumPath := filepath.Join(path, metadataPath("album", dl.metadataFormat))
+		manifest := AlbumManifest{Node: node, Images: allImages}
+		if err := writeMetadata(dl.storage, albumPath, dl.metadataFormat, manifest); err != nil {
+			log.Errorf("can't write album metadata for %v: %v", albumPath, err)
+		}
+	}
+
+	return int(atomic.LoadInt32(&failures))
 }
 
 type FolderURLBuilder struct {
@@ -363,9 +562,14 @@ func (b *FolderURLBuilder) URL(nodeID string, start int) (string, error) {
 	return folderURL.String(), nil
 }
 
-func loopFolder(cli *HTTPClient, fb *FolderURLBuilder, path, nodeID string) {
+// loopFolder walks one folder's pages, recursing into subfolders and
+// albums, and returns the number of images across the whole subtree that
+// failed to sync, so a node is only marked as synced in state once
+// everything under it actually succeeded.
+func loopFolder(cli *HTTPClient, dl *Downloader, fb *FolderURLBuilder, path, nodeID string) int {
 	start := 1
 	total := 0xffff
+	totalFailures := 0
 	// Loop Folder
 	log.Infof("Requesting folder at %q with nodeID %v", path, nodeID)
 	for start < total {
@@ -382,26 +586,53 @@ func loopFolder(cli *HTTPClient, fb *FolderURLBuilder, path, nodeID string) {
 		}
 
 		for _, node := range folder.Response.Node {
+			if node.Type == "Album" && !dl.since.IsZero() {
+				if dateAdded, err := time.Parse(time.RFC3339, node.DateAdded); err == nil && dateAdded.Before(dl.since) {
+					log.Infof("skipping album %q added %v, before -since cutoff", node.Name, node.DateAdded)
+					continue
+				}
+			}
+
+			if dl.state != nil && !dl.verify {
+				entry, found, err := dl.state.GetNode(node.NodeID)
+				if err != nil {
+					log.Errorf("can't read state for node %v: %v", node.NodeID, err)
+				} else if found && entry.DateModified == node.DateModified {
+					log.Infof("skipping unchanged %v %q", node.Type, node.Name)
+					continue
+				}
+			}
+
 			subPath := filepath.Join(path, node.Name)
-			if err := os.MkdirAll(subPath, 0755); err != nil {
+			if err := dl.storage.Mkdir(subPath); err != nil {
 				log.Errorf("cannot mkdir subPath %v: %v", subPath, err)
 				continue
 			}
+			var failures int
 			switch node.Type {
 			case "Folder":
-				loopFolder(cli, fb, subPath, node.NodeID)
+				failures = loopFolder(cli, dl, fb, subPath, node.NodeID)
 			case "Album":
 				ab := AlbumURLBuilder{APIKey: fb.APIKey, BaseURL: fb.BaseURL}
 				albumID := strings.TrimPrefix(node.Uris.Album.Uri, "/api/v2/album/")
-				loopAlbum(cli, &ab, subPath, albumID)
+				failures = loopAlbum(cli, dl, &ab, subPath, albumID, node)
 			default:
 				log.Errorf("Unexpected node.Type = %v", node.Type)
 				continue
 			}
+			totalFailures += failures
+
+			if dl.state != nil && failures == 0 {
+				entry := StateEntry{DateModified: node.DateModified, LocalPath: subPath}
+				if err := dl.state.PutNode(node.NodeID, entry); err != nil {
+					log.Errorf("can't update state for node %v: %v", node.NodeID, err)
+				}
+			}
 		}
 		total = folder.Response.Pages.Total
 		start += folder.Response.Pages.Count
 	}
+	return totalFailures
 }
 
 func main() {
@@ -409,17 +640,90 @@ func main() {
 	var smsessCookie string
 	var nodeID string
 	var baseURL string
+	var concurrency int
+	var storageURL string
+	var metadataFlag string
+	var stateFlag string
+	var verify bool
+	var sinceFlag string
+	var consumerKey string
+	var consumerSecret string
+	var accessToken string
+	var accessSecret string
+	var credentialsPath string
+	var authorize bool
+	var typesFlag string
 	flag.StringVar(&apiKey, "apiKey", "", "APIKey")
 	flag.StringVar(&smsessCookie, "smsessCookie", "", "SMSESS Cookie")
 	flag.StringVar(&nodeID, "nodeID", "", "main nodeID")
 	flag.StringVar(&baseURL, "baseURL", "", "base URL")
+	flag.IntVar(&concurrency, "concurrency", concurrencyDefault, "number of concurrent downloads")
+	flag.StringVar(&storageURL, "storage", ".", "where to mirror the tree: a local path, file://<dir>, s3://bucket/prefix, or an https:// PUT endpoint")
+	flag.StringVar(&metadataFlag, "metadata", string(MetadataNone), "sidecar metadata format to write alongside images and albums: json, yaml or none")
+	flag.StringVar(&stateFlag, "state", "", "path to a BoltDB file recording last-seen DateModified per node and DateTimeUploaded per image, to skip unchanged ones on later runs")
+	flag.BoolVar(&verify, "verify", false, "with -state, still MD5-verify existing files instead of trusting unchanged DateModified/DateTimeUploaded")
+	flag.StringVar(&sinceFlag, "since", "", "RFC3339 cutoff: skip albums added before this time")
+	flag.StringVar(&consumerKey, "consumerKey", "", "OAuth 1.0a consumer key")
+	flag.StringVar(&consumerSecret, "consumerSecret", "", "OAuth 1.0a consumer secret")
+	flag.StringVar(&accessToken, "accessToken", "", "OAuth 1.0a access token")
+	flag.StringVar(&accessSecret, "accessSecret", "", "OAuth 1.0a access token secret")
+	flag.StringVar(&credentialsPath, "credentials", "", "path to the OAuth credentials file (default ~/.config/smugmug-downloader/credentials.json)")
+	flag.BoolVar(&authorize, "authorize", false, "walk through the OAuth 1.0a authorize flow with -consumerKey/-consumerSecret, then save credentials and exit")
+	flag.StringVar(&typesFlag, "types", "image,video", "comma-separated asset types to download: image, video")
 	flag.Parse()
 
+	if credentialsPath == "" {
+		var err error
+		credentialsPath, err = defaultCredentialsPath()
+		if err != nil {
+			log.Fatalf("can't determine default credentials path: %v", err)
+		}
+	}
+
+	if authorize {
+		if err := runAuthorize(consumerKey, consumerSecret, credentialsPath); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	creds, err := loadCredentials(credentialsPath)
+	if err != nil {
+		log.Fatalf("can't load credentials from %v: %v", credentialsPath, err)
+	}
+	if creds != nil {
+		if consumerKey == "" {
+			consumerKey = creds.ConsumerKey
+		}
+		if consumerSecret == "" {
+			consumerSecret = creds.ConsumerSecret
+		}
+		if accessToken == "" {
+			accessToken = creds.AccessToken
+		}
+		if accessSecret == "" {
+			accessSecret = creds.AccessSecret
+		}
+	}
+
+	var oauth *OAuth1Signer
+	if consumerKey != "" && accessToken != "" {
+		oauth = &OAuth1Signer{
+			ConsumerKey:    consumerKey,
+			ConsumerSecret: consumerSecret,
+			Token:          accessToken,
+			TokenSecret:    accessSecret,
+		}
+		if apiKey == "" {
+			apiKey = consumerKey
+		}
+	}
+
 	if apiKey == "" {
 		log.Fatalf("Missing apiKey flag")
 	}
-	if smsessCookie == "" {
-		log.Fatalf("Missing smsessCookie flag")
+	if oauth == nil && smsessCookie == "" {
+		log.Fatalf("Missing credentials: set -smsessCookie, or -consumerKey/-accessToken (or run -authorize)")
 	}
 	if nodeID == "" {
 		log.Fatalf("Missing nodeID flag")
@@ -427,9 +731,57 @@ func main() {
 	if baseURL == "" {
 		log.Fatalf("Missing baseURL flag")
 	}
+	if concurrency <= 0 {
+		log.Fatalf("concurrency must be > 0")
+	}
+
+	wantTypes := map[string]bool{}
+	for _, t := range strings.Split(typesFlag, ",") {
+		t = strings.TrimSpace(t)
+		if t != "image" && t != "video" {
+			log.Fatalf("unknown -types entry %q, want image or video", t)
+		}
+		wantTypes[t] = true
+	}
+
+	storage, err := NewStorage(storageURL)
+	if err != nil {
+		log.Fatalf("can't initialize storage %q: %v", storageURL, err)
+	}
+	metadataFormat, err := parseMetadataFormat(metadataFlag)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	var state *State
+	if stateFlag != "" {
+		state, err = OpenState(stateFlag)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer state.Close()
+	}
+
+	var since time.Time
+	if sinceFlag != "" {
+		since, err = time.Parse(time.RFC3339, sinceFlag)
+		if err != nil {
+			log.Fatalf("can't parse -since %q: %v", sinceFlag, err)
+		}
+	}
 
-	cli := NewHTTPClient(userAgentDefault, smsessCookie)
+	cli := NewHTTPClient(userAgentDefault, smsessCookie, oauth, concurrency)
+	dl := NewDownloader(cli, storage, metadataFormat, state, verify, since, wantTypes, concurrency)
 
 	fb := FolderURLBuilder{APIKey: apiKey, BaseURL: baseURL}
-	loopFolder(cli, &fb, ".", nodeID)
+	if failures := loopFolder(cli, dl, &fb, ".", nodeID); failures > 0 {
+		log.Warnf("%v images failed to sync; re-run to retry them", failures)
+	}
+	dl.Close()
+
+	if metadataFormat != MetadataNone {
+		if err := writeManifest(storage, dl.manifest); err != nil {
+			log.Errorf("can't write manifest: %v", err)
+		}
+	}
 }
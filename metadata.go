@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetadataFormat selects the sidecar format written alongside downloaded
+// images and albums.
+type MetadataFormat string
+
+const (
+	MetadataNone MetadataFormat = "none"
+	MetadataJSON MetadataFormat = "json"
+	MetadataYAML MetadataFormat = "yaml"
+)
+
+func parseMetadataFormat(s string) (MetadataFormat, error) {
+	switch MetadataFormat(s) {
+	case MetadataNone, MetadataJSON, MetadataYAML:
+		return MetadataFormat(s), nil
+	default:
+		return "", fmt.Errorf("unknown -metadata format %q, want json, yaml or none", s)
+	}
+}
+
+// ext returns the sidecar file extension for the format, e.g. "json".
+func (f MetadataFormat) ext() string {
+	return string(f)
+}
+
+func marshalMetadata(format MetadataFormat, v interface{}) ([]byte, error) {
+	switch format {
+	case MetadataYAML:
+		return yaml.Marshal(v)
+	default:
+		return json.MarshalIndent(v, "", "  ")
+	}
+}
+
+// writeMetadata marshals v in format and writes it to path on storage.
+func writeMetadata(storage Storage, path string, format MetadataFormat, v interface{}) error {
+	data, err := marshalMetadata(format, v)
+	if err != nil {
+		return fmt.Errorf("can't marshal metadata for %v: %w", path, err)
+	}
+	w, err := storage.Writer(path)
+	if err != nil {
+		return fmt.Errorf("can't open metadata writer for %v: %w", path, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return fmt.Errorf("can't write metadata %v: %w", path, err)
+	}
+	return w.Commit()
+}
+
+// metadataPath returns the sidecar path for filePath under format, e.g.
+// "foo.jpg" -> "foo.jpg.json".
+func metadataPath(filePath string, format MetadataFormat) string {
+	return fmt.Sprintf("%v.%v", filePath, format.ext())
+}
+
+// AlbumManifest is the per-album sidecar written as "album.json"
+// (or "album.yaml"), capturing the album's Node and its full,
+// pagination-flattened image list.
+type AlbumManifest struct {
+	Node   Node
+	Images []Image
+}
+
+// ManifestEntry records one mirrored file's expected MD5, as reported by
+// SmugMug, for later verification runs.
+type ManifestEntry struct {
+	Path string
+	MD5  string
+}
+
+// Manifest is the top-level "manifest.json" written at the mirror root,
+// recording every file the walk expects to find and its MD5.
+type Manifest struct {
+	mu    sync.Mutex
+	Files []ManifestEntry
+}
+
+func (m *Manifest) Record(path, md5 string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files = append(m.Files, ManifestEntry{Path: path, MD5: md5})
+}
+
+// writeManifest writes the accumulated Manifest as JSON to "manifest.json"
+// at the storage root, for use by later verification runs.
+func writeManifest(storage Storage, manifest *Manifest) error {
+	manifest.mu.Lock()
+	defer manifest.mu.Unlock()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal manifest: %w", err)
+	}
+	w, err := storage.Writer("manifest.json")
+	if err != nil {
+		return fmt.Errorf("can't open manifest writer: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return fmt.Errorf("can't write manifest: %w", err)
+	}
+	return w.Commit()
+}
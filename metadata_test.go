@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParseMetadataFormat(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    MetadataFormat
+		wantErr bool
+	}{
+		{in: "none", want: MetadataNone},
+		{in: "json", want: MetadataJSON},
+		{in: "yaml", want: MetadataYAML},
+		{in: "xml", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseMetadataFormat(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseMetadataFormat(%q) = %v, nil, want an error", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseMetadataFormat(%q) returned unexpected error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseMetadataFormat(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestMetadataPath(t *testing.T) {
+	cases := []struct {
+		filePath string
+		format   MetadataFormat
+		want     string
+	}{
+		{filePath: "01_IMG_0001.jpg", format: MetadataJSON, want: "01_IMG_0001.jpg.json"},
+		{filePath: "album", format: MetadataYAML, want: "album.yaml"},
+	}
+	for _, c := range cases {
+		if got := metadataPath(c.filePath, c.format); got != c.want {
+			t.Errorf("metadataPath(%q, %q) = %q, want %q", c.filePath, c.format, got, c.want)
+		}
+	}
+}
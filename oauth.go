@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	smugmugRequestTokenURL = "https://secure.smugmug.com/services/oauth/1.0a/getRequestToken"
+	smugmugAuthorizeURL    = "https://secure.smugmug.com/services/oauth/1.0a/authorize"
+	smugmugAccessTokenURL  = "https://secure.smugmug.com/services/oauth/1.0a/getAccessToken"
+)
+
+// OAuth1Signer signs requests per SmugMug's OAuth 1.0a (RFC 5849) flow,
+// using HMAC-SHA1 over the request's base string. Token/TokenSecret are
+// left empty while still exchanging a request token.
+type OAuth1Signer struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	Token          string
+	TokenSecret    string
+}
+
+// rfc3986Escape percent-encodes s the way RFC 5849 requires, which differs
+// from url.QueryEscape only in encoding space as "%20" rather than "+".
+func rfc3986Escape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "%7E", "~")
+	return s
+}
+
+func nonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// authParams computes the full set of OAuth protocol parameters for a
+// request to rawURL, including the oauth_signature, merging in any
+// extraParams (e.g. oauth_callback, oauth_verifier).
+func (s *OAuth1Signer) authParams(method, rawURL string, extraParams map[string]string) (map[string]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse URL %q: %w", rawURL, err)
+	}
+
+	n, err := nonce()
+	if err != nil {
+		return nil, fmt.Errorf("can't generate nonce: %w", err)
+	}
+
+	oauthParams := map[string]string{
+		"oauth_consumer_key":     s.ConsumerKey,
+		"oauth_nonce":            n,
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+	if s.Token != "" {
+		oauthParams["oauth_token"] = s.Token
+	}
+	for k, v := range extraParams {
+		oauthParams[k] = v
+	}
+
+	params := u.Query()
+	for k, v := range oauthParams {
+		params.Set(k, v)
+	}
+
+	baseURL := fmt.Sprintf("%v://%v%v", u.Scheme, u.Host, u.Path)
+	oauthParams["oauth_signature"] = s.signature(method, baseURL, params)
+	return oauthParams, nil
+}
+
+func (s *OAuth1Signer) signature(method, baseURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range params[k] {
+			pairs = append(pairs, rfc3986Escape(k)+"="+rfc3986Escape(v))
+		}
+	}
+	paramString := strings.Join(pairs, "&")
+	baseString := strings.ToUpper(method) + "&" + rfc3986Escape(baseURL) + "&" + rfc3986Escape(paramString)
+	signingKey := rfc3986Escape(s.ConsumerSecret) + "&" + rfc3986Escape(s.TokenSecret)
+
+	mac := hmac.New(sha1.New, []byte(signingKey))
+	mac.Write([]byte(baseString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func authHeader(oauthParams map[string]string) string {
+	keys := make([]string, 0, len(oauthParams))
+	for k := range oauthParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(`%v="%v"`, k, rfc3986Escape(oauthParams[k])))
+	}
+	return "OAuth " + strings.Join(parts, ", ")
+}
+
+// Sign adds an RFC 5849 Authorization header to req.
+func (s *OAuth1Signer) Sign(req *http.Request) error {
+	oauthParams, err := s.authParams(req.Method, req.URL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authHeader(oauthParams))
+	return nil
+}
+
+// requestToken fetches a temporary request token to start the "authorize
+// in a browser, then exchange for an access token" exchange, per
+// https://api.smugmug.com/api/v2/doc/tutorial/authorization.html.
+func requestToken(consumerKey, consumerSecret string) (token, secret string, err error) {
+	signer := &OAuth1Signer{ConsumerKey: consumerKey, ConsumerSecret: consumerSecret}
+	values, err := oauthGet(signer, smugmugRequestTokenURL, map[string]string{"oauth_callback": "oob"})
+	if err != nil {
+		return "", "", err
+	}
+	return values.Get("oauth_token"), values.Get("oauth_token_secret"), nil
+}
+
+// accessToken exchanges a request token and the verifier PIN the user
+// read off the SmugMug authorize page for a permanent access token.
+func accessToken(consumerKey, consumerSecret, token, tokenSecret, verifier string) (accessToken, accessSecret string, err error) {
+	signer := &OAuth1Signer{ConsumerKey: consumerKey, ConsumerSecret: consumerSecret, Token: token, TokenSecret: tokenSecret}
+	values, err := oauthGet(signer, smugmugAccessTokenURL, map[string]string{"oauth_verifier": verifier})
+	if err != nil {
+		return "", "", err
+	}
+	return values.Get("oauth_token"), values.Get("oauth_token_secret"), nil
+}
+
+func oauthGet(signer *OAuth1Signer, rawURL string, extraParams map[string]string) (url.Values, error) {
+	oauthParams, err := signer.authParams("GET", rawURL, extraParams)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authHeader(oauthParams))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: resp.StatusCode is %v, body: %v", rawURL, resp.StatusCode, string(body))
+	}
+	return url.ParseQuery(string(body))
+}
+
+func authorizeURL(token string) string {
+	params := url.Values{}
+	params.Set("oauth_token", token)
+	params.Set("Access", "Full")
+	params.Set("Permissions", "Read")
+	return fmt.Sprintf("%v?%v", smugmugAuthorizeURL, params.Encode())
+}
+
+// openBrowser best-effort opens url in the user's default browser.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
+
+// Credentials holds the OAuth 1.0a consumer and access token pair
+// persisted across runs after a successful -authorize flow.
+type Credentials struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	AccessToken    string
+	AccessSecret   string
+}
+
+func defaultCredentialsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "smugmug-downloader", "credentials.json"), nil
+}
+
+func loadCredentials(path string) (*Credentials, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+func saveCredentials(path string, creds Credentials) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// runAuthorize walks the user through the request-token -> browser
+// authorize -> access-token exchange and persists the resulting
+// credentials to credentialsPath.
+func runAuthorize(consumerKey, consumerSecret, credentialsPath string) error {
+	if consumerKey == "" || consumerSecret == "" {
+		return fmt.Errorf("-authorize requires -consumerKey and -consumerSecret")
+	}
+
+	token, secret, err := requestToken(consumerKey, consumerSecret)
+	if err != nil {
+		return fmt.Errorf("can't get request token: %w", err)
+	}
+
+	authURL := authorizeURL(token)
+	fmt.Printf("Open this URL in your browser to authorize smugmug-downloader:\n\n%v\n\n", authURL)
+	if err := openBrowser(authURL); err != nil {
+		log.Warnf("can't open browser automatically: %v", err)
+	}
+
+	fmt.Print("Enter the verifier PIN shown after authorizing: ")
+	reader := bufio.NewReader(os.Stdin)
+	verifier, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("can't read verifier PIN: %w", err)
+	}
+	verifier = strings.TrimSpace(verifier)
+
+	accTok, accSecret, err := accessToken(consumerKey, consumerSecret, token, secret, verifier)
+	if err != nil {
+		return fmt.Errorf("can't get access token: %w", err)
+	}
+
+	creds := Credentials{
+		ConsumerKey:    consumerKey,
+		ConsumerSecret: consumerSecret,
+		AccessToken:    accTok,
+		AccessSecret:   accSecret,
+	}
+	if err := saveCredentials(credentialsPath, creds); err != nil {
+		return fmt.Errorf("can't save credentials to %v: %w", credentialsPath, err)
+	}
+
+	log.Infof("Saved credentials to %v", credentialsPath)
+	return nil
+}
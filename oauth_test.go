@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+// TestRFC3986Escape checks rfc3986Escape against the exact examples given
+// in RFC 5849 section 3.6.
+func TestRFC3986Escape(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"abcABC123", "abcABC123"},
+		{"-._~", "-._~"},
+		{"%", "%25"},
+		{"+", "%2B"},
+		{"&=*", "%26%3D%2A"},
+	}
+	for _, c := range cases {
+		if got := rfc3986Escape(c.in); got != c.want {
+			t.Errorf("rfc3986Escape(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+// TestSignature checks signature against the worked example in RFC 5849
+// section 1.2: a GET to http://photos.example.net/photos?file=vacation.jpg&size=original,
+// which the RFC documents as producing the Authorization header
+// oauth_signature="tR3%2BTy81lMeYAr%2FFid0kMTYa%2FWM%3D".
+func TestSignature(t *testing.T) {
+	s := &OAuth1Signer{
+		ConsumerSecret: "kd94hf93k423kf44",
+		TokenSecret:    "pfkkdhi9sl3r4s00",
+	}
+	params := url.Values{}
+	params.Set("file", "vacation.jpg")
+	params.Set("size", "original")
+	params.Set("oauth_consumer_key", "dpf43f3p2l4k3l03")
+	params.Set("oauth_token", "nnch734d00sl2jdk")
+	params.Set("oauth_signature_method", "HMAC-SHA1")
+	params.Set("oauth_timestamp", "1191242096")
+	params.Set("oauth_nonce", "kllo9940pd9333jh")
+	params.Set("oauth_version", "1.0")
+
+	want := "tR3+Ty81lMeYAr/Fid0kMTYa/WM="
+	if got := s.signature("GET", "http://photos.example.net/photos", params); got != want {
+		t.Errorf("signature() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sessionNameRegexp splits a file's basename into a session name and a
+// trailing numeric index, e.g. "IMG_0001" -> ("IMG_", "0001"), so
+// consecutively-numbered files from the same shooting session share a
+// "%02d_" prefix in loopAlbum, and a repeated index starts the next one.
+var sessionNameRegexp = regexp.MustCompile(`^([^0-9]*)([0-9]+)$`)
+
+// session tracks the running sequence count for one session name, and
+// which (index, ext) pairs it has already seen. Keying seen by ext as
+// well as index keeps same-numbered files of different types -- e.g. a
+// paired photo and video, IMG_0001.jpg and IMG_0001.mp4 -- from colliding
+// and bumping the sequence for every file after them.
+type session struct {
+	count int
+	seen  map[string]bool
+}
+
+// splitSessionName splits fileName's basename into a session name and
+// numeric index, e.g. "IMG_0001.jpg" -> ("IMG_", 1). A basename with no
+// trailing digits is its own one-off session, e.g. "cover.jpg" -> ("cover", 0).
+func splitSessionName(fileName string) (name string, index int, err error) {
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+	match := sessionNameRegexp.FindStringSubmatch(base)
+	if match == nil {
+		return base, 0, nil
+	}
+	index, err = strconv.Atoi(match[2])
+	if err != nil {
+		return "", 0, fmt.Errorf("can't convert %q to int: %w", match[2], err)
+	}
+	return match[1], index, nil
+}
+
+// nextPrefix returns the "%02d" sequence prefix for a file at (index,
+// ext) within sessionName's tracked sessions, bumping the session's count
+// whenever (index, ext) repeats so that a true index collision still
+// starts a new sequence, without treating a same-numbered file of a
+// different extension as a repeat.
+func nextPrefix(sessions map[string]*session, sessionName string, index int, ext string) string {
+	s, ok := sessions[sessionName]
+	if !ok {
+		s = &session{seen: make(map[string]bool)}
+		sessions[sessionName] = s
+	}
+	key := fmt.Sprintf("%d%s", index, ext)
+	if s.seen[key] {
+		s.count++
+		s.seen = make(map[string]bool)
+	}
+	s.seen[key] = true
+	return fmt.Sprintf("%02d", s.count)
+}
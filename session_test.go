@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestSplitSessionName(t *testing.T) {
+	cases := []struct {
+		fileName  string
+		wantName  string
+		wantIndex int
+	}{
+		{fileName: "IMG_0001.jpg", wantName: "IMG_", wantIndex: 1},
+		{fileName: "IMG_0042.mp4", wantName: "IMG_", wantIndex: 42},
+		{fileName: "cover.jpg", wantName: "cover", wantIndex: 0},
+	}
+	for _, c := range cases {
+		name, index, err := splitSessionName(c.fileName)
+		if err != nil {
+			t.Errorf("splitSessionName(%q) returned unexpected error: %v", c.fileName, err)
+			continue
+		}
+		if name != c.wantName || index != c.wantIndex {
+			t.Errorf("splitSessionName(%q) = (%q, %v), want (%q, %v)", c.fileName, name, index, c.wantName, c.wantIndex)
+		}
+	}
+}
+
+// TestNextPrefixSameIndexDifferentExt is a regression test for a bug where
+// a photo and video sharing a basename (e.g. a paired capture) collided on
+// the session's index tracker and corrupted the sequence for every file
+// after them.
+func TestNextPrefixSameIndexDifferentExt(t *testing.T) {
+	sessions := make(map[string]*session)
+
+	if got := nextPrefix(sessions, "IMG_", 1, ".jpg"); got != "00" {
+		t.Errorf("first .jpg at index 1: got %q, want %q", got, "00")
+	}
+	if got := nextPrefix(sessions, "IMG_", 1, ".mp4"); got != "00" {
+		t.Errorf("paired .mp4 at the same index: got %q, want %q (must not bump the sequence)", got, "00")
+	}
+	if got := nextPrefix(sessions, "IMG_", 2, ".jpg"); got != "00" {
+		t.Errorf("next .jpg at index 2: got %q, want %q", got, "00")
+	}
+}
+
+func TestNextPrefixRepeatedIndexBumpsSequence(t *testing.T) {
+	sessions := make(map[string]*session)
+
+	nextPrefix(sessions, "IMG_", 1, ".jpg")
+	if got := nextPrefix(sessions, "IMG_", 1, ".jpg"); got != "01" {
+		t.Errorf("true repeat of (index, ext): got %q, want %q", got, "01")
+	}
+}
+
+func TestNextPrefixIndependentSessions(t *testing.T) {
+	sessions := make(map[string]*session)
+
+	nextPrefix(sessions, "IMG_", 1, ".jpg")
+	nextPrefix(sessions, "IMG_", 1, ".jpg") // bumps IMG_ to count 1
+	if got := nextPrefix(sessions, "DSC_", 1, ".jpg"); got != "00" {
+		t.Errorf("unrelated session name: got %q, want %q", got, "00")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	stateNodesBucket  = []byte("nodes")
+	stateImagesBucket = []byte("images")
+)
+
+// StateEntry is what's persisted per Node/Image between runs, enough to
+// tell whether it changed on SmugMug without re-hashing the local file.
+type StateEntry struct {
+	DateModified     string
+	DateTimeUploaded string
+	ArchivedMD5      string
+	LocalPath        string
+}
+
+// State is a local BoltDB-backed cache of what was last seen for each
+// NodeID/ImageKey, used to skip unchanged folders/albums/images on
+// subsequent runs without re-walking and re-hashing everything.
+type State struct {
+	db *bolt.DB
+}
+
+// OpenState opens (creating if needed) the BoltDB file at path.
+func OpenState(path string) (*State, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("can't open state db %v: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(stateNodesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(stateImagesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't initialize state db %v: %w", path, err)
+	}
+	return &State{db: db}, nil
+}
+
+func (s *State) Close() error {
+	return s.db.Close()
+}
+
+func (s *State) get(bucket []byte, key string) (StateEntry, bool, error) {
+	var entry StateEntry
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &entry)
+	})
+	return entry, found, err
+}
+
+func (s *State) put(bucket []byte, key string, entry StateEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+func (s *State) GetNode(nodeID string) (StateEntry, bool, error) {
+	return s.get(stateNodesBucket, nodeID)
+}
+
+func (s *State) PutNode(nodeID string, entry StateEntry) error {
+	return s.put(stateNodesBucket, nodeID, entry)
+}
+
+func (s *State) GetImage(imageKey string) (StateEntry, bool, error) {
+	return s.get(stateImagesBucket, imageKey)
+}
+
+func (s *State) PutImage(imageKey string, entry StateEntry) error {
+	return s.put(stateImagesBucket, imageKey, entry)
+}